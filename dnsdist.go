@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const apiDnsdistJSONStatEndpoint = "jsonstat"
+
+// DnsdistDynBlock is a single entry returned by the
+// 'jsonstat?command=dynblocklist' endpoint, keyed by client network in the
+// surrounding map.
+type DnsdistDynBlock struct {
+	Seconds int64  `json:"seconds"`
+	Blocks  int64  `json:"blocks"`
+	Reason  string `json:"reason"`
+}
+
+// DnsdistServer is a single downstream server entry returned by the
+// 'jsonstat?command=servers' endpoint.
+type DnsdistServer struct {
+	Name    string  `json:"name"`
+	Address string  `json:"address"`
+	State   string  `json:"state"`
+	Queries float64 `json:"queries"`
+}
+
+// DnsdistPool is a single pool entry returned by the
+// 'jsonstat?command=pools' endpoint.
+type DnsdistPool struct {
+	Name        string  `json:"name"`
+	Servers     float64 `json:"servers"`
+	CacheHits   float64 `json:"cacheHits"`
+	CacheMisses float64 `json:"cacheMisses"`
+}
+
+// fetchDnsdistJSONStat fetches and decodes a single 'jsonstat' command
+// response from dnsdist.
+func fetchDnsdistJSONStat(ctx context.Context, client *http.Client, hostURL *url.URL, apiKey, command string, data interface{}) error {
+	u := apiURL(hostURL, apiDnsdistJSONStatEndpoint) + "?command=" + command
+	return getJSON(ctx, client, u, apiKey, data)
+}
+
+// makeDnsdistRTimeHistogram creates a fixed-value response time histogram
+// from the dnsdist jsonstat 'stats' statistics map, analogous to
+// makeRecursorRTimeHistogram.
+func makeDnsdistRTimeHistogram(statsMap map[string]float64) (prometheus.Metric, error) {
+	buckets := make(map[float64]uint64)
+	var count uint64
+	for k, v := range dnsdistRTimeBucketMap {
+		value, ok := statsMap[k]
+		if !ok {
+			return nil, fmt.Errorf("Required dnsdist stats key not found: %s", k)
+		}
+		if v != 0 {
+			buckets[v] = uint64(value)
+		}
+		count += uint64(value)
+	}
+
+	var keys []float64
+	for k := range buckets {
+		keys = append(keys, k)
+	}
+	sort.Float64s(keys)
+	var cumsum uint64
+	for _, k := range keys {
+		cumsum = cumsum + buckets[k]
+		buckets[k] = cumsum
+	}
+
+	desc := prometheus.NewDesc(
+		namespace+"_dnsdist_response_time_seconds",
+		"Histogram of dnsdist response times in seconds.",
+		[]string{},
+		prometheus.Labels{},
+	)
+
+	h := prometheus.MustNewConstHistogram(desc, count, 0, buckets)
+	return h, nil
+}
+
+var dnsdistDynBlockedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "dnsdist", "dyn_blocked_clients"),
+	"Number of queries blocked by each currently active dynamic block entry, keyed by the client network it applies to.",
+	[]string{"network", "reason"},
+	nil,
+)
+
+var dnsdistDownstreamUpDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "dnsdist", "downstream_up"),
+	"Whether dnsdist considers this downstream server up (1) or not (0).",
+	[]string{"server", "address"},
+	nil,
+)
+
+var dnsdistDownstreamQueriesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "dnsdist", "downstream_queries_total"),
+	"Total number of queries sent to this downstream server.",
+	[]string{"server", "address"},
+	nil,
+)
+
+var dnsdistPoolServersDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "dnsdist", "pool_servers"),
+	"Number of downstream servers in this pool.",
+	[]string{"pool"},
+	nil,
+)
+
+var dnsdistPoolCacheHitsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "dnsdist", "pool_cache_hits_total"),
+	"Total number of cache hits for this pool.",
+	[]string{"pool"},
+	nil,
+)
+
+var dnsdistPoolCacheMissesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "dnsdist", "pool_cache_misses_total"),
+	"Total number of cache misses for this pool.",
+	[]string{"pool"},
+	nil,
+)
+
+// collectDnsdistJSONStats scrapes dnsdist's jsonstat endpoints and emits a
+// response time histogram built from the ring-buffer backed statistics plus
+// gauges for the dynamic blocks currently in effect.
+func (e *Exporter) collectDnsdistJSONStats(ch chan<- prometheus.Metric) {
+	ctx, cancel := e.scrapeContext()
+	defer cancel()
+
+	var stats map[string]float64
+	if err := fetchDnsdistJSONStat(ctx, e.client, e.HostURL, e.ApiKey, "stats", &stats); err != nil {
+		log.Errorf("Error scraping dnsdist jsonstat stats: %v", err)
+		e.jsonParseFailures.Inc()
+		return
+	}
+	if h, err := makeDnsdistRTimeHistogram(stats); err != nil {
+		log.Errorf("Could not create dnsdist response time histogram: %v", err)
+	} else {
+		ch <- h
+	}
+
+	var dynBlocks map[string]DnsdistDynBlock
+	if err := fetchDnsdistJSONStat(ctx, e.client, e.HostURL, e.ApiKey, "dynblocklist", &dynBlocks); err != nil {
+		log.Errorf("Error scraping dnsdist jsonstat dynblocklist: %v", err)
+		e.jsonParseFailures.Inc()
+		return
+	}
+	for network, block := range dynBlocks {
+		ch <- prometheus.MustNewConstMetric(dnsdistDynBlockedDesc, prometheus.GaugeValue, float64(block.Blocks), network, block.Reason)
+	}
+}
+
+// collectDnsdistServers scrapes dnsdist's downstream server and pool listings
+// and emits per-server up/down state plus per-pool sizing and cache counters.
+func (e *Exporter) collectDnsdistServers(ch chan<- prometheus.Metric) {
+	ctx, cancel := e.scrapeContext()
+	defer cancel()
+
+	var servers []DnsdistServer
+	if err := fetchDnsdistJSONStat(ctx, e.client, e.HostURL, e.ApiKey, "servers", &servers); err != nil {
+		log.Errorf("Error scraping dnsdist jsonstat servers: %v", err)
+		e.jsonParseFailures.Inc()
+		return
+	}
+	for _, s := range servers {
+		up := 0.0
+		if s.State == "up" {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(dnsdistDownstreamUpDesc, prometheus.GaugeValue, up, s.Name, s.Address)
+		ch <- prometheus.MustNewConstMetric(dnsdistDownstreamQueriesDesc, prometheus.CounterValue, s.Queries, s.Name, s.Address)
+	}
+
+	var pools []DnsdistPool
+	if err := fetchDnsdistJSONStat(ctx, e.client, e.HostURL, e.ApiKey, "pools", &pools); err != nil {
+		log.Errorf("Error scraping dnsdist jsonstat pools: %v", err)
+		e.jsonParseFailures.Inc()
+		return
+	}
+	for _, p := range pools {
+		ch <- prometheus.MustNewConstMetric(dnsdistPoolServersDesc, prometheus.GaugeValue, p.Servers, p.Name)
+		ch <- prometheus.MustNewConstMetric(dnsdistPoolCacheHitsDesc, prometheus.CounterValue, p.CacheHits, p.Name)
+		ch <- prometheus.MustNewConstMetric(dnsdistPoolCacheMissesDesc, prometheus.CounterValue, p.CacheMisses, p.Name)
+	}
+}
@@ -54,6 +54,25 @@ var (
 		"unreachables":        "ns_unreachable",
 		"outgoing-timeouts":   "outgoing_timeout",
 	}
+
+	// dnsdist reports response-time buckets down to 50ms, unlike the recursor.
+	dnsdistRTimeBucketMap = map[string]float64{
+		"latency0-1":      .001,
+		"latency1-10":     .01,
+		"latency10-50":    .05,
+		"latency50-100":   .1,
+		"latency100-1000": 1,
+		"latency-slow":    0,
+	}
+
+	dnsdistRTimeLabelMap = map[string]string{
+		"latency0-1":      "0_1ms",
+		"latency1-10":     "1_10ms",
+		"latency10-50":    "10_50ms",
+		"latency50-100":   "50_100ms",
+		"latency100-1000": "100_1000ms",
+		"latency-slow":    "over_1000ms",
+	}
 )
 
 // PowerDNS recursor metrics definitions
@@ -174,8 +193,47 @@ var (
 
 // PowerDNS Dnsdist metrics definitions
 var (
-	dnsdistGaugeDefs      = []gaugeDefinition{}
-	dnsdistCounterDefs = []counterDefinition{}
+	dnsdistGaugeDefs = []gaugeDefinition{
+		gaugeDefinition{1, "latency_average_seconds", "Exponential moving average of the query-to-response latency.", "latency-avg100"},
+		gaugeDefinition{2, "uptime_seconds", "Uptime of the dnsdist daemon in seconds.", "uptime"},
+		gaugeDefinition{3, "cache_entries", "Number of entries in the packet cache.", "cache-entries"},
+	}
+
+	dnsdistCounterDefs = []counterDefinition{
+		counterDefinition{
+			1, "queries_total", "Total number of queries received.", "result",
+			map[string]string{"queries": "received"},
+		},
+		counterDefinition{
+			2, "responses_total", "Total number of responses sent to clients.", "result",
+			map[string]string{"responses": "sent"},
+		},
+		counterDefinition{
+			3, "rule_actions_total", "Total number of queries matched by a rule, by action taken.", "action",
+			map[string]string{"rule-drop": "drop", "rule-nxdomain": "nxdomain", "rule-refused": "refused"},
+		},
+		counterDefinition{
+			4, "self_answered_total", "Total number of queries answered directly by dnsdist without reaching a backend.", "type",
+			map[string]string{"self-answered": "self_answered"},
+		},
+		counterDefinition{
+			5, "cache_lookups_total", "Total number of packet cache lookups by result.", "result",
+			map[string]string{"cache-hits": "hit", "cache-misses": "miss"},
+		},
+		counterDefinition{6, "answers_rtime_total", "Total number of answers grouped by response time slots.", "timeslot", dnsdistRTimeLabelMap},
+		counterDefinition{
+			7, "dyn_blocked_total", "Total number of queries dropped by the dynamic blocking engine.", "type",
+			map[string]string{"dyn-blocked": "dyn_blocked"},
+		},
+		counterDefinition{
+			8, "frontend_queries_total", "Total number of queries received by frontend protocol.", "proto",
+			map[string]string{"udp-queries": "udp", "tcp-queries": "tcp"},
+		},
+		counterDefinition{
+			9, "downstream_errors_total", "Total number of errors talking to downstream servers, by error.", "error",
+			map[string]string{"downstream-send-errors": "send_error", "downstream-timeouts": "timeout"},
+		},
+	}
 )
 
 // Creates a fixed-value response time histogram from the following stats counters:
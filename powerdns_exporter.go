@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -24,22 +31,70 @@ const (
 	apiStatsEndpoint = "servers/localhost/statistics"
 )
 
-var (
-	client = &http.Client{
+// newHTTPClient builds the *http.Client shared by an Exporter's scrapes. A nil
+// tlsConfig leaves the transport's defaults (system trust store, no client
+// certificate) in place.
+func newHTTPClient(tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
 		Transport: &http.Transport{
-			Dial: func(netw, addr string) (net.Conn, error) {
-				c, err := net.DialTimeout(netw, addr, 5*time.Second)
-				if err != nil {
-					return nil, err
-				}
-				if err := c.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-					return nil, err
-				}
-				return c, nil
-			},
+			TLSClientConfig: tlsConfig,
 		},
 	}
-)
+}
+
+// buildTLSConfig assembles a *tls.Config from the --tls-* flags so the
+// exporter can talk to a PowerDNS API fronted by an mTLS-terminating reverse
+// proxy. It returns a nil config, leaving the transport's defaults in place,
+// when none of the flags were set.
+func buildTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// resolveAPIKey layers the available credential sources, from highest to
+// lowest priority: --api-key-file (re-read on SIGHUP for rotation), the
+// POWERDNS_API_KEY environment variable, and finally the --api-key flag.
+func resolveAPIKey(flagKey, keyFile string) (string, error) {
+	if keyFile != "" {
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if env := os.Getenv("POWERDNS_API_KEY"); env != "" {
+		return env, nil
+	}
+
+	return flagKey, nil
+}
 
 // ServerInfo is used to parse JSON data from 'servers/localhost' endpoint
 type ServerInfo struct {
@@ -52,20 +107,69 @@ type ServerInfo struct {
 	ZonesUrl   string `json:"zones_url"`
 }
 
-// StatsEntry is used to parse JSON data from 'servers/localhost/statistics' endpoint
-type StatsEntry struct {
+// StatsMapItem is a single entry of a "MapStatisticItem" StatsEntry, as
+// returned for ring-buffer backed stats (top query names, qtypes, remotes, ...)
+// when the statistics endpoint is queried with includerings=true.
+type StatsMapItem struct {
 	Name  string  `json:"name"`
-	Kind  string  `json:"type"`
-	Value float64 `json:"value,string,omitempty"`
+	Value float64 `json:"value,string"`
+}
+
+// StatsEntry is used to parse JSON data from the 'servers/localhost/statistics'
+// endpoint. Most entries are a flat name/value pair ("StatisticItem"), but
+// ring-buffer backed entries come back as "MapStatisticItem" whose value is an
+// array of StatsMapItem rather than a single scalar, so StatsEntry implements
+// json.Unmarshaler to decode both shapes.
+type StatsEntry struct {
+	Name  string
+	Kind  string
+	Value float64
+	Map   []StatsMapItem
+}
+
+func (s *StatsEntry) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name  string          `json:"name"`
+		Kind  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	s.Name = raw.Name
+	s.Kind = raw.Kind
+
+	switch s.Kind {
+	case "MapStatisticItem", "RingStatisticItem":
+		return json.Unmarshal(raw.Value, &s.Map)
+	}
+
+	var str string
+	if err := json.Unmarshal(raw.Value, &str); err != nil {
+		// Some other array- or object-valued stat type we don't know how to
+		// decode yet; skip it rather than failing the whole scrape.
+		return nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return err
+	}
+	s.Value = value
+	return nil
 }
 
 // Exporter collects PowerDNS stats from the given HostURL and exports them using
 // the prometheus metrics package.
 type Exporter struct {
-	HostURL    *url.URL
-	ServerType string
-	ApiKey     string
-	mutex      sync.RWMutex
+	HostURL      *url.URL
+	ServerType   string
+	ApiKey       string
+	CollectZones bool
+	CollectRings bool
+	RingsSize    int
+	RingsAllow   *regexp.Regexp
+	mutex        sync.RWMutex
 
 	up                prometheus.Gauge
 	totalScrapes      prometheus.Counter
@@ -88,8 +192,9 @@ func newGaugeMetric(serverType, metricName, docString string) prometheus.Gauge {
 	)
 }
 
-// NewExporter returns an initialized Exporter.
-func NewExporter(apiKey, serverType string, hostURL *url.URL) *Exporter {
+// NewExporter returns an initialized Exporter. httpClient is used for every
+// request the Exporter makes against hostURL; its Timeout bounds each scrape.
+func NewExporter(apiKey, serverType string, hostURL *url.URL, httpClient *http.Client) *Exporter {
 	var gaugeDefs []gaugeDefinition
 	var counterDefs []counterDefinition
 
@@ -151,7 +256,18 @@ func NewExporter(apiKey, serverType string, hostURL *url.URL) *Exporter {
 		counterMetrics: counterMetrics,
 		gaugeDefs:      gaugeDefs,
 		counterDefs:    counterDefs,
+		client:         httpClient,
+	}
+}
+
+// scrapeContext returns a context bounded by the Exporter's http.Client
+// timeout, so a single slow or stuck PowerDNS API can't stall a scrape
+// indefinitely.
+func (e *Exporter) scrapeContext() (context.Context, context.CancelFunc) {
+	if e.client.Timeout > 0 {
+		return context.WithTimeout(context.Background(), e.client.Timeout)
 	}
+	return context.WithCancel(context.Background())
 }
 
 // Describe describes all the metrics ever exported by the PowerDNS exporter. It
@@ -181,6 +297,15 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	ch <- e.totalScrapes
 	ch <- e.jsonParseFailures
 	e.collectMetrics(ch, jsonStats)
+
+	if e.ServerType == "dnsdist" {
+		e.collectDnsdistJSONStats(ch)
+		e.collectDnsdistServers(ch)
+	}
+
+	if e.ServerType == "authoritative" && e.CollectZones {
+		e.collectZones(ch)
+	}
 }
 
 func (e *Exporter) scrape(jsonStats chan<- []StatsEntry) {
@@ -188,9 +313,15 @@ func (e *Exporter) scrape(jsonStats chan<- []StatsEntry) {
 
 	e.totalScrapes.Inc()
 
+	ctx, cancel := e.scrapeContext()
+	defer cancel()
+
 	var data []StatsEntry
 	url := apiURL(e.HostURL, apiStatsEndpoint)
-	err := getJSON(url, e.ApiKey, &data)
+	if e.CollectRings {
+		url += "?includerings=true"
+	}
+	err := getJSON(ctx, e.client, url, e.ApiKey, &data)
 	if err != nil {
 		e.up.Set(0)
 		e.jsonParseFailures.Inc()
@@ -207,6 +338,11 @@ func (e *Exporter) collectMetrics(ch chan<- prometheus.Metric, jsonStats <-chan
 	statsMap := make(map[string]float64)
 	stats := <-jsonStats
 	for _, s := range stats {
+		// Entries with a non-empty Map (MapStatisticItem, RingStatisticItem)
+		// have no scalar Value; collectRings reads them from stats instead.
+		if len(s.Map) > 0 {
+			continue
+		}
 		statsMap[s.Name] = s.Value
 	}
 	if len(statsMap) == 0 {
@@ -216,7 +352,7 @@ func (e *Exporter) collectMetrics(ch chan<- prometheus.Metric, jsonStats <-chan
 	for _, def := range e.gaugeDefs {
 		if value, ok := statsMap[def.key]; ok {
 			// latency gauges need to be converted from microseconds to seconds
-			if strings.HasSuffix(def.key, "latency") {
+			if strings.HasSuffix(def.key, "latency") || strings.HasPrefix(def.key, "latency-") {
 				value = value / 1000000
 			}
 			e.gaugeMetrics[def.id].Set(value)
@@ -245,12 +381,16 @@ func (e *Exporter) collectMetrics(ch chan<- prometheus.Metric, jsonStats <-chan
 		}
 		ch <- h
 	}
+
+	if e.CollectRings {
+		e.collectRings(ch, stats)
+	}
 }
 
-func getServerInfo(hostURL *url.URL, apiKey string) (*ServerInfo, error) {
+func getServerInfo(ctx context.Context, client *http.Client, hostURL *url.URL, apiKey string) (*ServerInfo, error) {
 	var info ServerInfo
 	url := apiURL(hostURL, apiInfoEndpoint)
-	err := getJSON(url, apiKey, &info)
+	err := getJSON(ctx, client, url, apiKey, &info)
 	if err != nil {
 		return nil, err
 	}
@@ -258,8 +398,8 @@ func getServerInfo(hostURL *url.URL, apiKey string) (*ServerInfo, error) {
 	return &info, nil
 }
 
-func getJSON(url, apiKey string, data interface{}) error {
-	req, err := http.NewRequest("GET", url, nil)
+func getJSON(ctx context.Context, client *http.Client, url, apiKey string, data interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
@@ -293,12 +433,71 @@ func apiURL(hostURL *url.URL, path string) string {
 	return u.String()
 }
 
+// probeHandler implements a blackbox-exporter style /probe endpoint: it takes a
+// target PowerDNS API URL (and optional api_key/server_type overrides) from the
+// query string, runs a single ephemeral scrape against it and renders the result
+// to a fresh registry instead of the process-wide one. This lets a single
+// exporter process be pointed at many PowerDNS servers/recursors/dnsdist nodes
+// from a central Prometheus job via relabel_configs.
+func probeHandler(w http.ResponseWriter, r *http.Request, defaultApiKey string, probeTimeout time.Duration, tlsConfig *tls.Config) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	hostURL, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing target: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	apiKey := r.URL.Query().Get("api_key")
+	if apiKey == "" {
+		apiKey = defaultApiKey
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	probeClient := newHTTPClient(tlsConfig, probeTimeout)
+
+	serverType := r.URL.Query().Get("server_type")
+	if serverType == "" {
+		info, err := getServerInfo(ctx, probeClient, hostURL, apiKey)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Could not auto-detect server_type: %v", err), http.StatusBadRequest)
+			return
+		}
+		serverType = info.DaemonType
+	}
+
+	registry := prometheus.NewRegistry()
+	exporter := NewExporter(apiKey, serverType, hostURL, probeClient)
+	registry.MustRegister(exporter)
+
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	http.TimeoutHandler(h, probeTimeout, "Timeout scraping target").ServeHTTP(w, r)
+}
+
 func main() {
 	var (
 		listenAddress = flag.String("listen-address", ":9120", "Address to listen on for web interface and telemetry.")
 		metricsPath   = flag.String("metric-path", "/metrics", "Path under which to expose metrics.")
 		apiURL        = flag.String("api-url", "http://localhost:8001/", "Base-URL of PowerDNS authoritative server/recursor API.")
-		apiKey        = flag.String("api-key", "", "PowerDNS API Key")
+		apiKey        = flag.String("api-key", "", "PowerDNS API Key. Overridden by POWERDNS_API_KEY and --api-key-file if set.")
+		apiKeyFile    = flag.String("api-key-file", "", "Path to a file containing the PowerDNS API Key. Re-read on SIGHUP, takes precedence over POWERDNS_API_KEY and --api-key.")
+		probeTimeout  = flag.Duration("probe.timeout-default", 10*time.Second, "Default timeout for /probe requests against a target.")
+		collectZones  = flag.Bool("collect.zones", false, "Collect per-zone metrics from the authoritative server's zones endpoint.")
+		collectRings  = flag.Bool("collect.rings", false, "Collect ring-buffer metrics (top query names/qtypes/remotes) from the statistics endpoint.")
+		ringsSize     = flag.Int("rings.size", defaultRingsSize, "Maximum number of entries exported per ring when --collect.rings is set.")
+		ringsAllow    = flag.String("rings.allow-label", "", "Optional regular expression; ring entries whose label does not match it are dropped.")
+		scrapeTimeout = flag.Duration("scrape.timeout", 5*time.Second, "Timeout for scraping the configured PowerDNS API.")
+		tlsCAFile     = flag.String("tls-ca-file", "", "Path to a PEM CA bundle used to verify the PowerDNS API's TLS certificate.")
+		tlsCertFile   = flag.String("tls-cert-file", "", "Path to a PEM client certificate used for TLS client authentication against the PowerDNS API.")
+		tlsKeyFile    = flag.String("tls-key-file", "", "Path to the PEM private key matching --tls-cert-file.")
+		tlsSkipVerify = flag.Bool("tls-insecure-skip-verify", false, "Skip TLS certificate verification when scraping the PowerDNS API.")
 	)
 	flag.Parse()
 
@@ -307,22 +506,71 @@ func main() {
 		log.Fatalf("Error parsing api-url: %v", err)
 	}
 
-	server, err := getServerInfo(hostURL, *apiKey)
+	tlsConfig, err := buildTLSConfig(*tlsCAFile, *tlsCertFile, *tlsKeyFile, *tlsSkipVerify)
+	if err != nil {
+		log.Fatalf("Error building TLS config: %v", err)
+	}
+
+	apiKeyValue, err := resolveAPIKey(*apiKey, *apiKeyFile)
+	if err != nil {
+		log.Fatalf("Error reading api-key-file: %v", err)
+	}
+
+	httpClient := newHTTPClient(tlsConfig, *scrapeTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *scrapeTimeout)
+	server, err := getServerInfo(ctx, httpClient, hostURL, apiKeyValue)
+	cancel()
 	if err != nil {
 		log.Fatalf("Could not fetch PowerDNS server info: %v", err)
 	}
 
-	exporter := NewExporter(*apiKey, server.DaemonType, hostURL)
+	exporter := NewExporter(apiKeyValue, server.DaemonType, hostURL, httpClient)
+	exporter.CollectZones = *collectZones
+	exporter.CollectRings = *collectRings
+	exporter.RingsSize = *ringsSize
+	if *ringsAllow != "" {
+		re, err := regexp.Compile(*ringsAllow)
+		if err != nil {
+			log.Fatalf("Error parsing rings.allow-label: %v", err)
+		}
+		exporter.RingsAllow = re
+	}
 	prometheus.MustRegister(exporter)
 
+	if *apiKeyFile != "" {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		go func() {
+			for range sighup {
+				log.Infof("Reloading API key from %s", *apiKeyFile)
+				newKey, err := resolveAPIKey(*apiKey, *apiKeyFile)
+				if err != nil {
+					log.Errorf("Error reloading api-key-file: %v", err)
+					continue
+				}
+				exporter.mutex.Lock()
+				exporter.ApiKey = newKey
+				exporter.mutex.Unlock()
+			}
+		}()
+	}
+
 	log.Infof("Starting Server: %s", *listenAddress)
 	http.Handle(*metricsPath, promhttp.Handler())
+	http.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+		exporter.mutex.RLock()
+		probeApiKey := exporter.ApiKey
+		exporter.mutex.RUnlock()
+		probeHandler(w, r, probeApiKey, *probeTimeout, tlsConfig)
+	})
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 						<head><title>PowerDNS Exporter</title></head>
 						<body>
 						<h1>PowerDNS Exporter</h1>
 						<p><a href='` + *metricsPath + `'>Metrics</a></p>
+						<p><a href='/probe?target=http://localhost:8001/'>Probe</a></p>
 						</body>
 						</html>`))
 	})
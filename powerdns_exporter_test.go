@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStatsEntryUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  StatsEntry
+	}{
+		{
+			name:  "StatisticItem",
+			input: `{"name":"uptime","type":"StatisticItem","value":"12345"}`,
+			want:  StatsEntry{Name: "uptime", Kind: "StatisticItem", Value: 12345},
+		},
+		{
+			name:  "MapStatisticItem",
+			input: `{"name":"query-types","type":"MapStatisticItem","value":[{"name":"A","value":"10"},{"name":"AAAA","value":"5"}]}`,
+			want: StatsEntry{
+				Name: "query-types",
+				Kind: "MapStatisticItem",
+				Map:  []StatsMapItem{{Name: "A", Value: 10}, {Name: "AAAA", Value: 5}},
+			},
+		},
+		{
+			name:  "RingStatisticItem",
+			input: `{"name":"queries","type":"RingStatisticItem","value":[{"name":"example.com.","value":"42"}]}`,
+			want: StatsEntry{
+				Name: "queries",
+				Kind: "RingStatisticItem",
+				Map:  []StatsMapItem{{Name: "example.com.", Value: 42}},
+			},
+		},
+		{
+			name:  "UnknownArrayValuedItem",
+			input: `{"name":"weird","type":"SomeFutureRingType","value":[{"name":"x","value":"1"}]}`,
+			want:  StatsEntry{Name: "weird", Kind: "SomeFutureRingType"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got StatsEntry
+			if err := json.Unmarshal([]byte(tt.input), &got); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalJSON() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultRingsSize caps how many entries of a ring are exported when
+// --rings.size is left unset, since the rings themselves can hold thousands
+// of entries.
+const defaultRingsSize = 20
+
+// ringDefinition maps a "RingStatisticItem" or "MapStatisticItem" entry
+// returned by the statistics endpoint (when queried with includerings=true) to
+// the Prometheus counter it is exported as.
+type ringDefinition struct {
+	key    string
+	metric string
+	label  string
+}
+
+var ringDefs = []ringDefinition{
+	{"queries", "top_queries", "qname"},
+	{"query-types", "top_query_types", "qtype"},
+	{"remotes", "top_query_remotes", "remote"},
+	{"servfail-remotes", "top_servfail_remotes", "remote"},
+	{"noerror-remotes", "top_noerror_remotes", "remote"},
+	{"nxdomain-remotes", "top_nxdomain_remotes", "remote"},
+	{"unauth-remotes", "top_unauth_update_remotes", "remote"},
+}
+
+// collectRings emits the top-N entries of each configured ring as a labeled
+// counter. It is guarded by the --collect.rings flag, and the number of
+// entries exported per ring is capped by RingsSize and optionally filtered by
+// RingsAllow, since ring labels (query names, remote addresses) can carry a
+// lot of cardinality.
+func (e *Exporter) collectRings(ch chan<- prometheus.Metric, stats []StatsEntry) {
+	size := e.RingsSize
+	if size <= 0 {
+		size = defaultRingsSize
+	}
+
+	for _, def := range ringDefs {
+		var items []StatsMapItem
+		for _, s := range stats {
+			if (s.Kind == "RingStatisticItem" || s.Kind == "MapStatisticItem") && s.Name == def.key {
+				items = s.Map
+				break
+			}
+		}
+		if items == nil {
+			continue
+		}
+
+		sort.Slice(items, func(i, j int) bool { return items[i].Value > items[j].Value })
+
+		desc := prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, e.ServerType, def.metric),
+			"Top entries of the PowerDNS '"+def.key+"' ring buffer.",
+			[]string{def.label},
+			nil,
+		)
+
+		for i, item := range items {
+			if i >= size {
+				break
+			}
+			if e.RingsAllow != nil && !e.RingsAllow.MatchString(item.Name) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, item.Value, item.Name)
+		}
+	}
+}
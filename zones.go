@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const apiZonesEndpoint = "servers/localhost/zones"
+
+// Zone is used to parse JSON data from the 'servers/localhost/zones' endpoint.
+type Zone struct {
+	Name           string `json:"name"`
+	Kind           string `json:"kind"`
+	Serial         int64  `json:"serial"`
+	NotifiedSerial int64  `json:"notified_serial"`
+	DNSSEC         bool   `json:"dnssec"`
+	LastCheck      int64  `json:"last_check"`
+}
+
+// zoneDefinition describes a single per-zone gauge derived from the zones
+// endpoint, analogous to gaugeDefinition/counterDefinition for the flat
+// statistics endpoint.
+type zoneDefinition struct {
+	name        string
+	desc        string
+	labels      []string
+	labelValues func(z Zone) []string
+	value       func(z Zone) float64
+}
+
+var zoneDefs = []zoneDefinition{
+	{
+		name:        "serial",
+		desc:        "Serial number of the zone's SOA record.",
+		labels:      []string{"zone", "kind"},
+		labelValues: func(z Zone) []string { return []string{z.Name, z.Kind} },
+		value:       func(z Zone) float64 { return float64(z.Serial) },
+	},
+	{
+		name:        "notified_serial",
+		desc:        "Serial number most recently notified by the zone's master.",
+		labels:      []string{"zone", "kind"},
+		labelValues: func(z Zone) []string { return []string{z.Name, z.Kind} },
+		value:       func(z Zone) float64 { return float64(z.NotifiedSerial) },
+	},
+	{
+		name:        "dnssec",
+		desc:        "Whether the zone is signed with DNSSEC (1) or not (0).",
+		labels:      []string{"zone"},
+		labelValues: func(z Zone) []string { return []string{z.Name} },
+		value: func(z Zone) float64 {
+			if z.DNSSEC {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name:        "last_check_seconds",
+		desc:        "Unix timestamp of the last time the zone was checked for freshness.",
+		labels:      []string{"zone"},
+		labelValues: func(z Zone) []string { return []string{z.Name} },
+		value:       func(z Zone) float64 { return float64(z.LastCheck) },
+	},
+}
+
+var zoneMetricDescs = func() map[string]*prometheus.Desc {
+	descs := make(map[string]*prometheus.Desc)
+	for _, def := range zoneDefs {
+		descs[def.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "authoritative_zone", def.name),
+			def.desc,
+			def.labels,
+			nil,
+		)
+	}
+	return descs
+}()
+
+// collectZones fetches the authoritative server's zones list and emits the
+// zoneDefs gauges for each zone. It is guarded by the --collect.zones flag
+// since a server with many zones can add significant metric cardinality.
+func (e *Exporter) collectZones(ch chan<- prometheus.Metric) {
+	ctx, cancel := e.scrapeContext()
+	defer cancel()
+
+	var zones []Zone
+	url := apiURL(e.HostURL, apiZonesEndpoint)
+	if err := getJSON(ctx, e.client, url, e.ApiKey, &zones); err != nil {
+		log.Errorf("Error scraping PowerDNS zones: %v", err)
+		e.jsonParseFailures.Inc()
+		return
+	}
+
+	for _, z := range zones {
+		for _, def := range zoneDefs {
+			ch <- prometheus.MustNewConstMetric(zoneMetricDescs[def.name], prometheus.GaugeValue, def.value(z), def.labelValues(z)...)
+		}
+	}
+}